@@ -0,0 +1,136 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+import (
+	"reflect"
+	"sync"
+)
+
+// autoCostLayouts memoizes, per concrete struct type, the field indices
+// DefaultAutoCostFunc walks. reflect.Type.NumField() is cheap on its own,
+// but hot Set paths call this once per value, so we keep the per-type work
+// out of the common case.
+var autoCostLayouts sync.Map // map[reflect.Type][]int
+
+func autoCostFieldLayout(t reflect.Type) []int {
+	if cached, ok := autoCostLayouts.Load(t); ok {
+		return cached.([]int)
+	}
+	fields := make([]int, t.NumField())
+	for i := range fields {
+		fields[i] = i
+	}
+	autoCostLayouts.Store(t, fields)
+	return fields
+}
+
+// DefaultAutoCostFunc estimates the retained size, in bytes, of an
+// arbitrary Go value by walking it with reflect. It's the default used
+// when Config.AutoCost is true, a Set is given cost == 0, and
+// Config.AutoCostFunc is nil; callers with a narrower value shape can
+// supply their own AutoCostFunc to avoid the reflect walk entirely.
+//
+// Strings contribute their length, slices and maps their backing storage
+// plus every element, and structs the sum of their fields. Pointers are
+// charged for the pointee's size on top of the pointer word itself, and
+// are only followed once each -- a visited-pointer set guards against
+// cycles, so self-referential values get a (harmless) undercount rather
+// than an infinite walk.
+func DefaultAutoCostFunc(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	w := autoCostWalker{visited: make(map[uintptr]bool)}
+	return w.walk(reflect.ValueOf(v))
+}
+
+type autoCostWalker struct {
+	visited map[uintptr]bool
+}
+
+func (w *autoCostWalker) walk(v reflect.Value) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		ptr := v.Pointer()
+		if w.visited[ptr] {
+			return int64(v.Type().Size())
+		}
+		w.visited[ptr] = true
+		return int64(v.Type().Size()) + w.walk(v.Elem())
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		return int64(v.Type().Size()) + w.walk(v.Elem())
+
+	case reflect.String:
+		return int64(v.Type().Size()) + int64(v.Len())
+
+	case reflect.Slice:
+		size := int64(v.Type().Size())
+		if v.IsNil() {
+			return size
+		}
+		elemSize := int64(v.Type().Elem().Size())
+		size += int64(v.Cap()) * elemSize
+		for i := 0; i < v.Len(); i++ {
+			// walk already counts the element's own shallow size, which is
+			// also baked into the cap()*elemSize backing-array charge
+			// above; subtract it back out so only the pointed-to "extra"
+			// is added a second time.
+			size += w.walk(v.Index(i)) - elemSize
+		}
+		return size
+
+	case reflect.Map:
+		size := int64(v.Type().Size())
+		if v.IsNil() {
+			return size
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			size += w.walk(iter.Key()) + w.walk(iter.Value())
+		}
+		return size
+
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += w.walk(v.Index(i))
+		}
+		return size
+
+	case reflect.Struct:
+		var size int64
+		for _, i := range autoCostFieldLayout(v.Type()) {
+			size += w.walk(v.Field(i))
+		}
+		return size
+
+	default:
+		return int64(v.Type().Size())
+	}
+}
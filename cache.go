@@ -0,0 +1,351 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	farm "github.com/dgryski/go-farm"
+)
+
+// Item is the unit NewCache's eviction policy and OnEvict/OnReject hooks
+// operate on. Key and Conflict are the (hash, conflict) pair keyToHash
+// produced for the original key. Value is only populated for items flowing
+// through OnEvict/OnReject, not for policy bookkeeping; Expiration is only
+// populated for items passed to OnReject.
+type Item struct {
+	Key        uint64
+	Conflict   uint64
+	Value      interface{}
+	Cost       int64
+	Expiration time.Time
+}
+
+// Config configures a Cache created with NewCache.
+type Config struct {
+	// NumCounters is the number of 4-bit access counters to keep for
+	// admission and eviction decisions: roughly 10x the number of items
+	// you expect to hold at once.
+	NumCounters int64
+
+	// MaxCost is the maximum cost the cache can hold, in whatever unit
+	// Set's cost argument (or Cost) is denominated in.
+	MaxCost int64
+
+	// BufferItems must be non-zero. Cache does not batch Get keys: each Get
+	// hands its single key to the policy, so the value is not otherwise used.
+	BufferItems int64
+
+	// Metrics, if true, tracks detailed hit/miss/cost statistics. Cache
+	// keeps them internally and has no exported accessor for them.
+	Metrics bool
+
+	// OnEvict is called for every item evicted from the cache.
+	OnEvict func(item *Item)
+
+	// OnReject is called for every item the policy rejected on Set.
+	OnReject func(item *Item)
+
+	// OnExit is called with a value as it leaves the cache, whether via
+	// eviction, rejection, or Del.
+	OnExit func(val interface{})
+
+	// KeyToHash hashes a Set/Get key down to the (hash, conflict) pair the
+	// policy and store key on. Defaults to defaultKeyToHash.
+	KeyToHash func(key interface{}) (uint64, uint64)
+
+	// Cost, if set, computes a Set's cost from its value when the caller
+	// passes cost == 0.
+	Cost func(value interface{}) int64
+
+	// IgnoreInternalCost is accepted but has no effect: Cache never adds an
+	// internal bookkeeping overhead to an item's cost.
+	IgnoreInternalCost bool
+
+	// Policy selects which eviction-policy implementation NewCache builds:
+	// PolicyTinyLFU (the default) or PolicySieve. See policy.go.
+	Policy PolicyKind
+
+	// AutoCost, if true, estimates a Set's cost from its value whenever the
+	// caller passes cost == 0, instead of treating it as a literal
+	// zero-cost item. AutoCostFunc chooses the estimator; it defaults to
+	// DefaultAutoCostFunc. When Cost is also set, Cost is used instead.
+	AutoCost bool
+
+	// AutoCostFunc overrides the estimator AutoCost uses. Ignored unless
+	// AutoCost is true.
+	AutoCostFunc func(value interface{}) int64
+
+	// TTLTickInterval, if positive, makes NewCache build its policy with
+	// proactive TTL reclamation: a background ticker firing at this
+	// interval sweeps out expired keys instead of leaving them for Get to
+	// notice. Zero keeps the default lazy behavior: an expired key lingers
+	// in the store until it's looked up (or evicted for other reasons).
+	// Only PolicyTinyLFU supports this; with PolicySieve it is ignored.
+	TTLTickInterval time.Duration
+
+	// TTLBucketGranularity controls how coarsely expirations are bucketed
+	// for that sweep; see ttlBuckets. Defaults to
+	// defaultTTLBucketGranularity. Ignored unless TTLTickInterval > 0.
+	TTLBucketGranularity time.Duration
+}
+
+// Cache is a thread-safe, bounded, cost-aware in-memory cache.
+type Cache struct {
+	store     *storedValues
+	policy    policy
+	keyToHash func(key interface{}) (uint64, uint64)
+	cost      func(value interface{}) int64
+	autoCost  func(value interface{}) int64
+	onEvict   func(item *Item)
+	onReject  func(item *Item)
+	onExit    func(val interface{})
+	metrics   *Metrics
+
+	closeOnce sync.Once
+}
+
+// defaultKeyToHash hashes ints directly and hashes strings/[]byte with
+// farm's fingerprint (for the policy's hash) and xxhash (for the conflict
+// check), mirroring the pair of independent hash functions TinyLFU's
+// admission estimate and the store's collision check each want.
+func defaultKeyToHash(key interface{}) (uint64, uint64) {
+	switch k := key.(type) {
+	case uint64:
+		return k, 0
+	case int64:
+		return uint64(k), 0
+	case int:
+		return uint64(k), 0
+	case string:
+		return farm.Fingerprint64([]byte(k)), xxhash.Sum64String(k)
+	case []byte:
+		return farm.Fingerprint64(k), xxhash.Sum64(k)
+	default:
+		return 0, 0
+	}
+}
+
+// NewCache builds a Cache from config, choosing the eviction policy
+// implementation it specifies.
+func NewCache(config *Config) (*Cache, error) {
+	switch {
+	case config == nil:
+		return nil, errors.New("Config can't be nil")
+	case config.NumCounters == 0:
+		return nil, errors.New("NumCounters can't be zero")
+	case config.MaxCost == 0:
+		return nil, errors.New("MaxCost can't be zero")
+	case config.BufferItems == 0:
+		return nil, errors.New("BufferItems can't be zero")
+	}
+
+	var p policy
+	if config.TTLTickInterval > 0 && config.Policy != PolicySieve {
+		p = newPolicyWithTTL(config.NumCounters, config.MaxCost, config.TTLTickInterval, config.TTLBucketGranularity)
+	} else {
+		p = newPolicyFor(config.Policy, config.NumCounters, config.MaxCost)
+	}
+
+	c := &Cache{
+		store:     newStore(),
+		policy:    p,
+		keyToHash: config.KeyToHash,
+		cost:      config.Cost,
+	}
+	if c.keyToHash == nil {
+		c.keyToHash = defaultKeyToHash
+	}
+
+	if config.AutoCost {
+		c.autoCost = config.AutoCostFunc
+		if c.autoCost == nil {
+			c.autoCost = DefaultAutoCostFunc
+		}
+	}
+
+	c.onExit = func(val interface{}) {
+		if config.OnExit != nil && val != nil {
+			config.OnExit(val)
+		}
+	}
+	c.onEvict = func(item *Item) {
+		if config.OnEvict != nil {
+			config.OnEvict(item)
+		}
+		c.onExit(item.Value)
+	}
+	c.onReject = func(item *Item) {
+		if config.OnReject != nil {
+			config.OnReject(item)
+		}
+		c.onExit(item.Value)
+	}
+
+	if config.Metrics {
+		c.metrics = newMetrics()
+	}
+	c.policy.CollectMetrics(c.metrics)
+
+	if lfu, ok := p.(*lfuPolicy); ok && lfu.expiredCh != nil {
+		go c.processExpired(lfu.expiredCh)
+	}
+
+	return c, nil
+}
+
+// processExpired drains items the policy's TTL sweep reclaimed proactively,
+// removing them from the store and running OnEvict/OnExit for each just as
+// Set's eviction path does. It returns once expiredCh is closed, which
+// Close triggers via the policy.
+func (c *Cache) processExpired(expiredCh <-chan []*Item) {
+	for items := range expiredCh {
+		for _, item := range items {
+			if conflict, value, ok := c.store.del(item.Key); ok {
+				item.Conflict = conflict
+				item.Value = value
+				c.onEvict(item)
+			}
+		}
+	}
+}
+
+// Get returns the value associated with key, if it's present and unexpired.
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	if c == nil || key == nil {
+		return nil, false
+	}
+	hash, conflict := c.keyToHash(key)
+	c.policy.Push([]uint64{hash})
+	value, ok := c.store.get(hash, conflict)
+	if ok {
+		c.metrics.add(hit, hash, 1)
+	} else {
+		c.metrics.add(miss, hash, 1)
+	}
+	return value, ok
+}
+
+// Set attempts to add key/value to the cache with the given cost, evicting
+// other keys as needed. It returns false if the item was rejected by the
+// eviction policy.
+func (c *Cache) Set(key, value interface{}, cost int64) bool {
+	return c.SetWithTTL(key, value, cost, 0)
+}
+
+// SetWithTTL is Set, but value is automatically removed after ttl elapses.
+// A non-positive ttl means no expiration, same as Set.
+func (c *Cache) SetWithTTL(key, value interface{}, cost int64, ttl time.Duration) bool {
+	if c == nil || key == nil {
+		return false
+	}
+
+	var expiration time.Time
+	if ttl > 0 {
+		expiration = time.Now().Add(ttl)
+	}
+
+	hash, conflict := c.keyToHash(key)
+
+	if cost == 0 {
+		switch {
+		case c.cost != nil:
+			cost = c.cost(value)
+		case c.autoCost != nil:
+			cost = c.autoCost(value)
+		}
+	}
+
+	victims, added := c.policy.Add(hash, cost)
+
+	// The policy can evict entries (or reclaim expired ones) before it
+	// rejects the incoming item, so victims leave the store either way.
+	for _, victim := range victims {
+		if oldConflict, oldValue, ok := c.store.del(victim.Key); ok {
+			victim.Conflict = oldConflict
+			victim.Value = oldValue
+			c.onEvict(victim)
+		}
+	}
+
+	if !added {
+		c.onReject(&Item{Key: hash, Conflict: conflict, Value: value, Cost: cost, Expiration: expiration})
+		return false
+	}
+
+	c.store.set(hash, conflict, value, expiration)
+	if ttlAware, ok := c.policy.(ttlAwarePolicy); ok {
+		ttlAware.trackTTL(hash, expiration)
+	}
+
+	return true
+}
+
+// Del removes key from the cache.
+func (c *Cache) Del(key interface{}) {
+	if c == nil || key == nil {
+		return
+	}
+	hash, _ := c.keyToHash(key)
+	c.policy.Del(hash)
+	if _, value, ok := c.store.del(hash); ok {
+		c.onExit(value)
+	}
+}
+
+// Wait is a no-op: unlike the buffered-Set design this Cache doesn't have,
+// Set and Del apply synchronously, so there's never anything pending.
+func (c *Cache) Wait() {}
+
+// Clear empties the cache, preserving its configured max cost.
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+	c.policy.Clear()
+	c.store.clear()
+}
+
+// Close stops the cache's background goroutines. The cache must not be used
+// afterward.
+func (c *Cache) Close() {
+	if c == nil {
+		return
+	}
+	c.closeOnce.Do(func() {
+		c.policy.Close()
+	})
+}
+
+// MaxCost returns the cache's max cost.
+func (c *Cache) MaxCost() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.policy.MaxCost()
+}
+
+// UpdateMaxCost updates the cache's max cost.
+func (c *Cache) UpdateMaxCost(maxCost int64) {
+	if c == nil {
+		return
+	}
+	c.policy.UpdateMaxCost(maxCost)
+}
@@ -17,16 +17,33 @@
 package ristretto
 
 import (
-	"math"
+	"container/heap"
 	"sync"
+	"time"
 )
 
 const (
-	// lfuSampleSize is the number of items to sample when looking at eviction
-	// candidates. 5 seems to be the most optimal number [citation needed].
-	lfuSampleSize = 5
+	// lfuSampleSize is the target working size of the victimHeap used to
+	// find eviction candidates. It used to bound a linear scan, which kept
+	// it small (5); now that picking a victim out of the heap is O(log N),
+	// a bigger sample is affordable and gives a higher-fidelity choice of
+	// victim.
+	lfuSampleSize = 20
 )
 
+var _ policy = (*lfuPolicy)(nil)
+
+// ttlAwarePolicy is implemented by policies that proactively reclaim
+// expired entries instead of relying solely on storedValues.get's
+// expiration check at Get time. Cache.SetWithTTL type-asserts against this so
+// policies that don't opt in (sievePolicy, for now) keep working
+// unchanged.
+type ttlAwarePolicy interface {
+	trackTTL(key uint64, expiresAt time.Time)
+}
+
+var _ ttlAwarePolicy = (*lfuPolicy)(nil)
+
 // lfuPolicy encapsulates eviction/admission behavior.
 type lfuPolicy struct {
 	sync.Mutex
@@ -37,6 +54,14 @@ type lfuPolicy struct {
 	stop          chan struct{}
 	isClosed      bool
 	metrics       *Metrics
+
+	// ttl, expirations, expiredCh, and ttlStop are only set up when the
+	// cache is configured with Config.TTLTickInterval > 0; otherwise
+	// expired items are left to storedValues.get's check at Get time.
+	ttl         *ttlBuckets
+	expirations map[uint64]time.Time
+	expiredCh   chan []*Item
+	ttlStop     chan struct{}
 }
 
 func newPolicy(numCounters, maxCost int64) *lfuPolicy {
@@ -56,6 +81,119 @@ func newPolicyWithSampleSize(numCounters, maxCost int64, lfuSampleSize int) *lfu
 	return p
 }
 
+// newPolicyWithTTL is newPolicy plus proactive TTL reclamation: a ticker,
+// firing every tickInterval, sweeps every ttlBuckets bucket whose
+// bucketGranularity-rounded expiration has passed, evicting those keys from
+// the policy itself rather than waiting for Get to notice they're stale.
+// NewCache calls this instead of newPolicy when Config.TTLTickInterval > 0
+// and Config.Policy isn't PolicySieve.
+func newPolicyWithTTL(numCounters, maxCost int64, tickInterval, bucketGranularity time.Duration) *lfuPolicy {
+	p := newPolicyWithSampleSize(numCounters, maxCost, lfuSampleSize)
+	p.ttl = newTTLBuckets(bucketGranularity)
+	p.expirations = make(map[uint64]time.Time)
+	p.expiredCh = make(chan []*Item, 3)
+	p.ttlStop = make(chan struct{})
+
+	go p.processExpirations(tickInterval)
+	return p
+}
+
+// trackTTL records key's expiration bucket so a later sweep can reclaim it
+// proactively. It's a no-op unless the policy was built with
+// newPolicyWithTTL.
+func (p *lfuPolicy) trackTTL(key uint64, expiresAt time.Time) {
+	if p.ttl == nil {
+		return
+	}
+
+	p.Lock()
+	if old, ok := p.expirations[key]; ok {
+		p.ttl.del(key, old)
+	}
+	if expiresAt.IsZero() {
+		delete(p.expirations, key)
+	} else {
+		p.expirations[key] = expiresAt
+		p.ttl.add(key, expiresAt)
+	}
+	p.Unlock()
+}
+
+// processExpirations wakes on a ticker, sweeps every expired TTL bucket,
+// and pushes the reclaimed items onto expiredCh for the Cache to drain and
+// run OnEvict/OnExit against.
+func (p *lfuPolicy) processExpirations(tickInterval time.Duration) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			items := p.sweepExpired(now)
+			if len(items) == 0 {
+				continue
+			}
+			// sweepExpired has already applied the removals to costs and
+			// expirations, so this send must not be dropped: a dropped
+			// batch here would desync the policy (which thinks the keys
+			// are gone) from the store (which still holds them) and would
+			// skip OnEvict/OnExit for them. Block until the Cache's drain
+			// catches up, but stay cancellable so Close doesn't hang.
+			select {
+			case p.expiredCh <- items:
+			case <-p.ttlStop:
+				return
+			}
+		case <-p.ttlStop:
+			return
+		}
+	}
+}
+
+// sweepExpired removes every key whose TTL bucket has come due as of now
+// and returns the corresponding Items. It's safe to call without holding
+// p.Lock(): p.ttl is only ever reassigned (by Clear) under that lock, so we
+// take a consistent snapshot of it before using it.
+func (p *lfuPolicy) sweepExpired(now time.Time) []*Item {
+	p.Lock()
+	ttl := p.ttl
+	p.Unlock()
+	if ttl == nil {
+		return nil
+	}
+
+	keys := ttl.sweep(now)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	p.Lock()
+	items := p.drainExpiredLocked(keys)
+	p.Unlock()
+	return items
+}
+
+// drainExpiredLocked removes already-expired keys from cost and expiration
+// tracking and returns the corresponding Items. The caller must hold
+// p.Lock().
+func (p *lfuPolicy) drainExpiredLocked(keys []uint64) []*Item {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	items := make([]*Item, 0, len(keys))
+	for _, key := range keys {
+		cost, ok := p.costs.keyCosts[key]
+		if !ok {
+			continue
+		}
+		p.costs.del(key)
+		delete(p.expirations, key)
+		items = append(items, &Item{Key: key, Cost: cost})
+	}
+	return items
+}
+
 func (p *lfuPolicy) CollectMetrics(metrics *Metrics) {
 	p.metrics = metrics
 	p.costs.metrics = metrics
@@ -127,31 +265,48 @@ func (p *lfuPolicy) Add(key uint64, cost int64) ([]*Item, bool) {
 		return nil, true
 	}
 
+	// If this policy proactively tracks TTLs, sweep out anything that's
+	// already expired before falling back to evicting live entries; this
+	// shrinks the victim search space and preserves higher-value entries
+	// under pressure.
+	var expired []*Item
+	if p.ttl != nil {
+		expired = p.drainExpiredLocked(p.ttl.sweep(time.Now()))
+		room = p.costs.roomLeft(cost)
+		if room >= 0 {
+			p.costs.add(key, cost)
+			p.metrics.add(costAdd, key, uint64(cost))
+			return expired, true
+		}
+	}
+
 	// incHits is the hit count for the incoming item.
 	incHits := p.admit.Estimate(key)
-	// sample is the eviction candidate pool to be filled via random sampling.
-	// TODO: perhaps we should use a min heap here. Right now our time
-	// complexity is N for finding the min. Min heap should bring it down to
-	// O(lg N).
-	sample := make([]*policyPair, 0, p.lfuSampleSize)
-	// As items are evicted they will be appended to victims.
-	victims := make([]*Item, 0)
-
-	// Delete victims until there's enough space or a minKey is found that has
-	// more hits than incoming item.
+	// vh is the eviction candidate pool, kept as a min-heap (by TinyLFU
+	// estimate) instead of a linearly-scanned sample so that finding the
+	// next victim is O(log N) rather than O(N).
+	vh := newVictimHeap(p.admit)
+	// As items are evicted they will be appended to victims, alongside any
+	// already-expired items the TTL sweep above reclaimed.
+	victims := expired
+
+	// Delete victims until there's enough space or the heap-min is found to
+	// have more hits than the incoming item.
 	for ; room < 0; room = p.costs.roomLeft(cost) {
-		// Fill up empty slots in sample.
-		sample = p.costs.fillSample(sample, p.lfuSampleSize)
-
-		// Find minimally used item in sample.
-		minKey, minHits, minId, minCost := uint64(0), int64(math.MaxInt64), 0, int64(0)
-		for i, pair := range sample {
-			// Look up hit count for sample key.
-			if hits := p.admit.Estimate(pair.key); hits < minHits {
-				minKey, minHits, minId, minCost = pair.key, hits, i, pair.cost
+		// Refill the heap if it's drained.
+		if vh.Len() == 0 {
+			vh.refill(p.costs, p.lfuSampleSize)
+			if vh.Len() == 0 {
+				// Nothing left to sample, but there's still no room: reject.
+				p.metrics.add(rejectSets, key, 1)
+				return victims, false
 			}
 		}
 
+		// Pop the minimally used item off the heap.
+		pair := heap.Pop(vh).(*policyPair)
+		minHits := p.admit.Estimate(pair.key)
+
 		// If the incoming item isn't worth keeping in the policy, reject.
 		if incHits < minHits {
 			p.metrics.add(rejectSets, key, 1)
@@ -159,16 +314,13 @@ func (p *lfuPolicy) Add(key uint64, cost int64) ([]*Item, bool) {
 		}
 
 		// Delete the victim from metadata.
-		p.costs.del(minKey)
+		p.costs.del(pair.key)
 
-		// Delete the victim from sample.
-		sample[minId] = sample[len(sample)-1]
-		sample = sample[:len(sample)-1]
 		// Store victim in evicted victims slice.
 		victims = append(victims, &Item{
-			Key:      minKey,
+			Key:      pair.key,
 			Conflict: 0,
-			Cost:     minCost,
+			Cost:     pair.cost,
 		})
 	}
 
@@ -187,6 +339,12 @@ func (p *lfuPolicy) Has(key uint64) bool {
 func (p *lfuPolicy) Del(key uint64) {
 	p.Lock()
 	p.costs.del(key)
+	if p.ttl != nil {
+		if expiresAt, ok := p.expirations[key]; ok {
+			p.ttl.del(key, expiresAt)
+			delete(p.expirations, key)
+		}
+	}
 	p.Unlock()
 }
 
@@ -218,6 +376,10 @@ func (p *lfuPolicy) Clear() {
 	//
 	p.admit.clear()
 	p.costs.clear()
+	if p.ttl != nil {
+		p.expirations = make(map[uint64]time.Time)
+		p.ttl = newTTLBuckets(p.ttl.granularity)
+	}
 	p.Unlock()
 }
 
@@ -230,6 +392,13 @@ func (p *lfuPolicy) Close() {
 	p.stop <- struct{}{}
 	close(p.stop)
 	close(p.itemsCh)
+
+	if p.ttlStop != nil {
+		p.ttlStop <- struct{}{}
+		close(p.ttlStop)
+		close(p.expiredCh)
+	}
+
 	p.isClosed = true
 }
 
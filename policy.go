@@ -0,0 +1,91 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+// policy encapsulates eviction/admission behavior for a Cache. lfuPolicy
+// (the default: TinyLFU admission plus sampled-LFU eviction) and sievePolicy
+// (FIFO list with a visited bit) both satisfy it, and Config.Policy picks
+// between them at NewCache time via newPolicyFor.
+type policy interface {
+	// Push adds the keys to the policy's "hit" tracking, so it knows which
+	// recently-accessed keys should be retained over others.
+	Push([]uint64) bool
+
+	// Add attempts to add the key-cost pair to the policy. It returns the
+	// list of victims that had to be evicted to make room, and a bool
+	// indicating whether the incoming key-cost pair was accepted.
+	Add(uint64, int64) ([]*Item, bool)
+
+	// Has returns true if the key exists in the policy.
+	Has(uint64) bool
+
+	// Del deletes the key from the policy.
+	Del(uint64)
+
+	// Cap returns the amount of capacity left: max cost minus used cost.
+	Cap() int64
+
+	// Update updates the cost value for the key.
+	Update(uint64, int64)
+
+	// Cost returns the cost value of a key, or -1 if it's missing.
+	Cost(uint64) int64
+
+	// Clear zeroes out all counters and clears hash maps.
+	Clear()
+
+	// Close stops all goroutines and closes all channels.
+	Close()
+
+	// MaxCost returns the current max cost of the cache policy.
+	MaxCost() int64
+
+	// UpdateMaxCost updates the max cost of the cache policy.
+	UpdateMaxCost(int64)
+
+	// CollectMetrics hooks the policy up to the cache's Metrics struct; it
+	// has to be done after construction, since Metrics are created after
+	// the policy.
+	CollectMetrics(*Metrics)
+}
+
+// PolicyKind names one of the eviction policy implementations NewCache can
+// build. It's the type of Config.Policy (see cache.go).
+type PolicyKind string
+
+const (
+	// PolicyTinyLFU is the default: sampled-LFU eviction with a TinyLFU
+	// admission filter. See default_policy.go.
+	PolicyTinyLFU PolicyKind = "tinylfu"
+
+	// PolicySieve is a FIFO-with-visited-bit eviction policy with no
+	// admission filter. It's cheaper per Get than PolicyTinyLFU and has
+	// been shown to beat TinyLFU on some web/CDN workloads. See
+	// sieve_policy.go.
+	PolicySieve PolicyKind = "sieve"
+)
+
+// newPolicyFor builds the policy implementation named by kind, defaulting
+// to PolicyTinyLFU. NewCache threads Config.Policy through to this.
+func newPolicyFor(kind PolicyKind, numCounters, maxCost int64) policy {
+	switch kind {
+	case PolicySieve:
+		return newSievePolicy(numCounters, maxCost)
+	default:
+		return newPolicy(numCounters, maxCost)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+import "sync"
+
+var _ policy = (*sievePolicy)(nil)
+
+// sieveNode is a single entry in sievePolicy's FIFO list.
+type sieveNode struct {
+	key     uint64
+	visited bool
+	prev    *sieveNode
+	next    *sieveNode
+}
+
+// sievePolicy implements the policy interface using SIEVE: a FIFO list of
+// resident keys, one visited bit per entry, and a "hand" that walks the
+// list backward looking for an unvisited entry to evict. New entries are
+// inserted at the head with visited == false. Unlike lfuPolicy there is no
+// admission filter to consult and no promotion-on-hit list churn -- Get
+// (via Push) is a single bit-set guarded by the same lock as everything
+// else here.
+type sievePolicy struct {
+	sync.Mutex
+	costs   *keyCosts
+	nodes   map[uint64]*sieveNode
+	head    *sieveNode
+	tail    *sieveNode
+	hand    *sieveNode
+	metrics *Metrics
+}
+
+func newSievePolicy(numCounters, maxCost int64) *sievePolicy {
+	return &sievePolicy{
+		costs: newSampledLFU(maxCost),
+		nodes: make(map[uint64]*sieveNode),
+	}
+}
+
+func (p *sievePolicy) CollectMetrics(metrics *Metrics) {
+	p.metrics = metrics
+	p.costs.metrics = metrics
+}
+
+// Push marks keys as visited. SIEVE has no admission filter to warm up, so
+// this just flips each resident key's bit.
+func (p *sievePolicy) Push(keys []uint64) bool {
+	if len(keys) == 0 {
+		return true
+	}
+
+	p.Lock()
+	for _, key := range keys {
+		if n, ok := p.nodes[key]; ok {
+			n.visited = true
+		}
+	}
+	p.Unlock()
+
+	p.metrics.add(keepGets, keys[0], uint64(len(keys)))
+	return true
+}
+
+func (p *sievePolicy) insertHead(n *sieveNode) {
+	n.prev = nil
+	n.next = p.head
+	if p.head != nil {
+		p.head.prev = n
+	}
+	p.head = n
+	if p.tail == nil {
+		p.tail = n
+	}
+}
+
+func (p *sievePolicy) remove(n *sieveNode) {
+	if p.hand == n {
+		p.hand = n.prev
+	}
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		p.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		p.tail = n.prev
+	}
+	n.prev, n.next = nil, nil
+}
+
+// evict runs the SIEVE hand: starting from where it last stopped (or the
+// tail, if this is the first eviction), it clears visited bits and steps
+// backward until it finds an entry with visited == false, which it evicts,
+// leaving the hand at that entry's predecessor.
+func (p *sievePolicy) evict() (key uint64, cost int64, ok bool) {
+	hand := p.hand
+	if hand == nil {
+		hand = p.tail
+	}
+
+	for hand != nil {
+		if hand.visited {
+			hand.visited = false
+			hand = hand.prev
+			if hand == nil {
+				hand = p.tail
+			}
+			continue
+		}
+
+		victim := hand
+		p.hand = victim.prev
+		cost = p.costs.keyCosts[victim.key]
+		p.remove(victim)
+		delete(p.nodes, victim.key)
+		p.costs.del(victim.key)
+		return victim.key, cost, true
+	}
+
+	return 0, 0, false
+}
+
+func (p *sievePolicy) Add(key uint64, cost int64) ([]*Item, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	// Cannot add an item bigger than entire cache.
+	if cost > p.costs.getMaxCost() {
+		return nil, false
+	}
+
+	// No need to go any further if the item is already in the cache.
+	if has := p.costs.updateIfHas(key, cost); has {
+		return nil, false
+	}
+
+	victims := make([]*Item, 0)
+	for room := p.costs.roomLeft(cost); room < 0; room = p.costs.roomLeft(cost) {
+		victimKey, victimCost, ok := p.evict()
+		if !ok {
+			// Nothing left to evict, but there's still no room: reject.
+			p.metrics.add(rejectSets, key, 1)
+			return victims, false
+		}
+		victims = append(victims, &Item{
+			Key:      victimKey,
+			Conflict: 0,
+			Cost:     victimCost,
+		})
+	}
+
+	p.costs.add(key, cost)
+	n := &sieveNode{key: key}
+	p.nodes[key] = n
+	p.insertHead(n)
+	p.metrics.add(costAdd, key, uint64(cost))
+	return victims, true
+}
+
+func (p *sievePolicy) Has(key uint64) bool {
+	p.Lock()
+	_, exists := p.nodes[key]
+	p.Unlock()
+	return exists
+}
+
+func (p *sievePolicy) Del(key uint64) {
+	p.Lock()
+	if n, ok := p.nodes[key]; ok {
+		p.remove(n)
+		delete(p.nodes, key)
+	}
+	p.costs.del(key)
+	p.Unlock()
+}
+
+func (p *sievePolicy) Cap() int64 {
+	p.Lock()
+	capacity := int64(p.costs.getMaxCost() - p.costs.used)
+	p.Unlock()
+	return capacity
+}
+
+func (p *sievePolicy) Update(key uint64, cost int64) {
+	p.Lock()
+	p.costs.updateIfHas(key, cost)
+	p.Unlock()
+}
+
+func (p *sievePolicy) Cost(key uint64) int64 {
+	p.Lock()
+	if cost, found := p.costs.keyCosts[key]; found {
+		p.Unlock()
+		return cost
+	}
+	p.Unlock()
+	return -1
+}
+
+func (p *sievePolicy) Clear() {
+	p.Lock()
+	p.costs.clear()
+	p.nodes = make(map[uint64]*sieveNode)
+	p.head, p.tail, p.hand = nil, nil, nil
+	p.Unlock()
+}
+
+// Close is a no-op: sievePolicy has no background goroutine, unlike
+// lfuPolicy's processItems.
+func (p *sievePolicy) Close() {}
+
+func (p *sievePolicy) MaxCost() int64 {
+	if p == nil || p.costs == nil {
+		return 0
+	}
+	return p.costs.getMaxCost()
+}
+
+func (p *sievePolicy) UpdateMaxCost(maxCost int64) {
+	if p == nil || p.costs == nil {
+		return
+	}
+	p.costs.updateMaxCost(maxCost)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+import (
+	"sync"
+	"time"
+)
+
+// numStoreShards is the number of shards storedValues spreads its entries
+// across to reduce lock contention between concurrent Get/Set calls.
+const numStoreShards = 256
+
+// storedValue is what storedValues keeps per resident key: the value
+// itself, the conflict hash used to detect hash collisions on Get, and an
+// optional expiration time.
+type storedValue struct {
+	conflict   uint64
+	value      interface{}
+	expiration time.Time
+}
+
+type storeShard struct {
+	sync.RWMutex
+	data map[uint64]storedValue
+}
+
+// storedValues is Cache's key/value storage, keyed by the hash half of
+// keyToHash's (hash, conflict) pair. The policy decides admission/eviction
+// using hash alone; storedValues is what actually holds the Value and
+// guards against two different keys colliding on that hash via the
+// conflict check in get. del removes by hash alone.
+type storedValues struct {
+	shards [numStoreShards]*storeShard
+}
+
+func newStore() *storedValues {
+	s := &storedValues{}
+	for i := range s.shards {
+		s.shards[i] = &storeShard{data: make(map[uint64]storedValue)}
+	}
+	return s
+}
+
+func (s *storedValues) shardFor(hash uint64) *storeShard {
+	return s.shards[hash%numStoreShards]
+}
+
+func (s *storedValues) get(hash, conflict uint64) (interface{}, bool) {
+	shard := s.shardFor(hash)
+	shard.RLock()
+	entry, ok := shard.data[hash]
+	shard.RUnlock()
+
+	if !ok || entry.conflict != conflict {
+		return nil, false
+	}
+	if !entry.expiration.IsZero() && time.Now().After(entry.expiration) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (s *storedValues) set(hash, conflict uint64, value interface{}, expiration time.Time) {
+	shard := s.shardFor(hash)
+	shard.Lock()
+	shard.data[hash] = storedValue{conflict: conflict, value: value, expiration: expiration}
+	shard.Unlock()
+}
+
+// del removes hash and returns what was stored for it, if anything.
+func (s *storedValues) del(hash uint64) (conflict uint64, value interface{}, ok bool) {
+	shard := s.shardFor(hash)
+	shard.Lock()
+	entry, ok := shard.data[hash]
+	delete(shard.data, hash)
+	shard.Unlock()
+	return entry.conflict, entry.value, ok
+}
+
+func (s *storedValues) clear() {
+	for _, shard := range s.shards {
+		shard.Lock()
+		shard.data = make(map[uint64]storedValue)
+		shard.Unlock()
+	}
+}
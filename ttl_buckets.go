@@ -0,0 +1,108 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultTTLBucketGranularity is how coarsely ttlBuckets rounds expiration
+// times when it isn't configured via Config.TTLBucketGranularity: a 5s
+// window keeps the number of buckets a sweep has to look at small without
+// delaying reclamation by much.
+const defaultTTLBucketGranularity = 5 * time.Second
+
+// ttlBuckets groups keys by a coarse expiration bucket so that reclaiming
+// everything that has expired is one pass over the buckets (one per
+// granularity window that holds a key) instead of one check per resident key.
+type ttlBuckets struct {
+	sync.Mutex
+	granularity time.Duration
+	buckets     map[int64]map[uint64]struct{}
+}
+
+func newTTLBuckets(granularity time.Duration) *ttlBuckets {
+	if granularity <= 0 {
+		granularity = defaultTTLBucketGranularity
+	}
+	return &ttlBuckets{
+		granularity: granularity,
+		buckets:     make(map[int64]map[uint64]struct{}),
+	}
+}
+
+func (b *ttlBuckets) bucketFor(t time.Time) int64 {
+	return t.UnixNano() / int64(b.granularity)
+}
+
+// add places key in the bucket for expiresAt. A zero expiresAt means "no
+// TTL" and is ignored.
+func (b *ttlBuckets) add(key uint64, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		return
+	}
+	id := b.bucketFor(expiresAt)
+
+	b.Lock()
+	if b.buckets[id] == nil {
+		b.buckets[id] = make(map[uint64]struct{})
+	}
+	b.buckets[id][key] = struct{}{}
+	b.Unlock()
+}
+
+// del removes key from the bucket for expiresAt, e.g. because the key was
+// deleted, updated with a new TTL, or already reclaimed by sweep.
+func (b *ttlBuckets) del(key uint64, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		return
+	}
+	id := b.bucketFor(expiresAt)
+
+	b.Lock()
+	if keys, ok := b.buckets[id]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(b.buckets, id)
+		}
+	}
+	b.Unlock()
+}
+
+// sweep removes and returns every key in a bucket whose time has passed as
+// of now.
+func (b *ttlBuckets) sweep(now time.Time) []uint64 {
+	cutoff := b.bucketFor(now)
+
+	b.Lock()
+	defer b.Unlock()
+
+	var expired []uint64
+	for id, keys := range b.buckets {
+		// A bucket has only come due once its window has fully elapsed, so
+		// the in-progress bucket (id == cutoff) is not yet expired.
+		if id >= cutoff {
+			continue
+		}
+		for key := range keys {
+			expired = append(expired, key)
+		}
+		delete(b.buckets, id)
+	}
+	return expired
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package typed provides a generic, type-safe wrapper around
+// github.com/tushar-zomato/ristretto.Cache. It lives in its own module
+// because it needs Go 1.18 generics, while the parent module stays on the
+// older Go version its existing users build with -- the same split
+// hashicorp/golang-lru/v2 and go-ethereum's common/lru took when they added
+// generic caches on top of an established package.
+package typed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	farm "github.com/dgryski/go-farm"
+	"github.com/tushar-zomato/ristretto"
+)
+
+// numShards is the number of shard[V] maps a Cache spreads its values
+// across, mirroring the sharding the underlying Cache's own store uses.
+const numShards = 256
+
+// KeyHasher computes the (hash, conflict) pair ristretto.Cache uses to
+// place and disambiguate a key; see ristretto.Config.KeyToHash.
+type KeyHasher[K comparable] func(k K) (uint64, uint64)
+
+// defaultHasher hashes the key's string form with two independent
+// functions, farm's fingerprint for the hash and xxhash for the conflict,
+// mirroring ristretto.defaultKeyToHash so storeKey's collision check is a
+// real second hash rather than a hard-coded 0. It's enough for any K whose
+// fmt.Sprintf("%v", k) is injective, which covers the usual comparable keys
+// (ints, strings, small structs).
+func defaultHasher[K comparable]() KeyHasher[K] {
+	return func(k K) (uint64, uint64) {
+		s := fmt.Sprintf("%v", k)
+		return farm.Fingerprint64([]byte(s)), xxhash.Sum64String(s)
+	}
+}
+
+// storeKey is what Cache passes as the "key" to the underlying
+// ristretto.Cache: the (hash, conflict) pair KeyHasher already computed for
+// K, decoded back out by the KeyToHash func NewCache installs. Routing both
+// halves through means the underlying Cache's own store does the real
+// collision check, instead of the typed layer silently trusting hash alone.
+type storeKey struct {
+	hash     uint64
+	conflict uint64
+}
+
+type shard[V any] struct {
+	sync.RWMutex
+	values map[storeKey]V
+}
+
+// call is one in-flight GetOrCompute loader invocation that other callers
+// for the same key wait on instead of starting their own.
+type call[V any] struct {
+	wg  sync.WaitGroup
+	val V
+	err error
+}
+
+// flightGroup deduplicates concurrent GetOrCompute loader calls for the
+// same key, singleflight-style.
+type flightGroup[V any] struct {
+	mu    sync.Mutex
+	calls map[uint64]*call[V]
+}
+
+func (g *flightGroup[V]) do(hash uint64, fn func() (V, error)) (V, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[uint64]*call[V])
+	}
+	if c, ok := g.calls[hash]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := new(call[V])
+	c.wg.Add(1)
+	g.calls[hash] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, hash)
+	g.mu.Unlock()
+
+	return c.val, c.err
+}
+
+// Config configures a typed Cache. NumCounters, MaxCost, and BufferItems
+// are passed straight through to the underlying ristretto.Config.
+type Config[K comparable] struct {
+	NumCounters int64
+	MaxCost     int64
+	BufferItems int64
+
+	// KeyHasher hashes K down to the (hash, conflict) pair the underlying
+	// Cache uses. Defaults to defaultHasher: farm's fingerprint (hash) and
+	// xxhash (conflict) of fmt.Sprintf("%v", k).
+	KeyHasher KeyHasher[K]
+}
+
+// Cache is a generic, type-safe wrapper around ristretto.Cache. Eviction,
+// admission, and cost accounting are delegated to the underlying Cache
+// unchanged; V values themselves live in Cache's own shard[V] maps rather
+// than boxed in interface{}, which is where the per-entry allocation cost
+// comes from on small-cost workloads.
+type Cache[K comparable, V any] struct {
+	cache  *ristretto.Cache
+	hasher KeyHasher[K]
+	shards [numShards]*shard[V]
+	flight flightGroup[V]
+}
+
+// NewCache builds a typed Cache on top of a fresh ristretto.Cache.
+func NewCache[K comparable, V any](config *Config[K]) (*Cache[K, V], error) {
+	c := &Cache[K, V]{hasher: config.KeyHasher}
+	if c.hasher == nil {
+		c.hasher = defaultHasher[K]()
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard[V]{values: make(map[storeKey]V)}
+	}
+
+	cache, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: config.NumCounters,
+		MaxCost:     config.MaxCost,
+		BufferItems: config.BufferItems,
+		KeyToHash: func(key interface{}) (uint64, uint64) {
+			sk := key.(storeKey)
+			return sk.hash, sk.conflict
+		},
+		OnEvict:  c.onRemove,
+		OnReject: c.onRemove,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.cache = cache
+	return c, nil
+}
+
+func (c *Cache[K, V]) shardFor(hash uint64) *shard[V] {
+	return c.shards[hash%numShards]
+}
+
+func (c *Cache[K, V]) onRemove(item *ristretto.Item) {
+	key := storeKey{hash: item.Key, conflict: item.Conflict}
+	s := c.shardFor(key.hash)
+	s.Lock()
+	delete(s.values, key)
+	s.Unlock()
+}
+
+// Get returns the value stored for k, if any.
+func (c *Cache[K, V]) Get(k K) (V, bool) {
+	hash, conflict := c.hasher(k)
+	key := storeKey{hash: hash, conflict: conflict}
+	if _, ok := c.cache.Get(key); !ok {
+		var zero V
+		return zero, false
+	}
+
+	s := c.shardFor(hash)
+	s.RLock()
+	v, ok := s.values[key]
+	s.RUnlock()
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return v, true
+}
+
+// Set attempts to store v for k with the given cost, evicting other keys as
+// needed. It returns false if v wasn't stored, matching ristretto.Cache.Set.
+func (c *Cache[K, V]) Set(k K, v V, cost int64) bool {
+	return c.setWithTTL(k, v, cost, 0)
+}
+
+// SetWithTTL is Set, but v is automatically removed after ttl elapses.
+func (c *Cache[K, V]) SetWithTTL(k K, v V, cost int64, ttl time.Duration) bool {
+	return c.setWithTTL(k, v, cost, ttl)
+}
+
+func (c *Cache[K, V]) setWithTTL(k K, v V, cost int64, ttl time.Duration) bool {
+	hash, conflict := c.hasher(k)
+	key := storeKey{hash: hash, conflict: conflict}
+	s := c.shardFor(hash)
+	s.Lock()
+	s.values[key] = v
+	s.Unlock()
+
+	var buffered bool
+	if ttl > 0 {
+		buffered = c.cache.SetWithTTL(key, struct{}{}, cost, ttl)
+	} else {
+		buffered = c.cache.Set(key, struct{}{}, cost)
+	}
+	if !buffered {
+		// Not stored. The underlying Cache has already run OnReject, which
+		// removes v; this delete repeats that removal.
+		s.Lock()
+		delete(s.values, key)
+		s.Unlock()
+	}
+	return buffered
+}
+
+// Del removes k from the cache.
+func (c *Cache[K, V]) Del(k K) {
+	hash, conflict := c.hasher(k)
+	key := storeKey{hash: hash, conflict: conflict}
+	c.cache.Del(key)
+	s := c.shardFor(hash)
+	s.Lock()
+	delete(s.values, key)
+	s.Unlock()
+}
+
+// Wait blocks until all pending Set/Del calls have been processed.
+func (c *Cache[K, V]) Wait() {
+	c.cache.Wait()
+}
+
+// Close stops the cache's background goroutines.
+func (c *Cache[K, V]) Close() {
+	c.cache.Close()
+}
+
+// GetOrCompute returns the cached value for k, computing and storing it via
+// loader on a miss. Concurrent misses for the same key are deduplicated so
+// loader runs at most once at a time per key.
+func (c *Cache[K, V]) GetOrCompute(k K, loader func(K) (V, int64, error)) (V, error) {
+	if v, ok := c.Get(k); ok {
+		return v, nil
+	}
+
+	hash, conflict := c.hasher(k)
+	return c.flight.do(hash^conflict, func() (V, error) {
+		if v, ok := c.Get(k); ok {
+			return v, nil
+		}
+		v, cost, err := loader(k)
+		if err != nil {
+			var zero V
+			return zero, err
+		}
+		c.Set(k, v, cost)
+		return v, nil
+	})
+}
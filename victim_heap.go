@@ -0,0 +1,86 @@
+/*
+ * Copyright 2020 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ristretto
+
+import (
+	"container/heap"
+	"math"
+)
+
+// victimHeap is a min-heap of eviction candidates ordered by TinyLFU
+// estimate, implementing heap.Interface over *policyPair. It replaces the
+// linear scan lfuPolicy.Add used to do over its sample: the heap-min is
+// always the least valuable candidate seen so far, so picking the next
+// victim (or discovering that none is worse than the incoming item) is an
+// O(log N) Pop instead of an O(N) walk.
+type victimHeap struct {
+	admit *tinyLFU
+	pairs []*policyPair
+}
+
+func newVictimHeap(admit *tinyLFU) *victimHeap {
+	return &victimHeap{
+		admit: admit,
+		pairs: make([]*policyPair, 0, lfuSampleSize),
+	}
+}
+
+func (h *victimHeap) Len() int { return len(h.pairs) }
+
+func (h *victimHeap) Less(i, j int) bool {
+	return h.admit.Estimate(h.pairs[i].key) < h.admit.Estimate(h.pairs[j].key)
+}
+
+func (h *victimHeap) Swap(i, j int) {
+	h.pairs[i], h.pairs[j] = h.pairs[j], h.pairs[i]
+}
+
+func (h *victimHeap) Push(x interface{}) {
+	h.pairs = append(h.pairs, x.(*policyPair))
+}
+
+func (h *victimHeap) Pop() interface{} {
+	old := h.pairs
+	n := len(old)
+	pair := old[n-1]
+	old[n-1] = nil
+	h.pairs = old[:n-1]
+	return pair
+}
+
+// refill tops the heap back up to target by drawing fresh candidates from
+// costs via fillSample, the same random-sampling source lfuPolicy.Add has
+// always used.
+func (h *victimHeap) refill(costs *keyCosts, target int) {
+	h.pairs = costs.fillSample(h.pairs, target)
+	heap.Init(h)
+}
+
+// scanMinVictim finds the sample entry with the lowest TinyLFU estimate by
+// linear scan -- this is lfuPolicy.Add's victim-selection step exactly as it
+// was before victimHeap replaced it, kept only so BenchmarkVictimScan can
+// measure the O(N) baseline the heap's O(log N) Pop is meant to beat. It
+// returns the index into sample and that entry's estimate.
+func scanMinVictim(sample []*policyPair, admit *tinyLFU) (minIdx int, minHits int64) {
+	minHits = math.MaxInt64
+	for i, pair := range sample {
+		if hits := admit.Estimate(pair.key); hits < minHits {
+			minIdx, minHits = i, hits
+		}
+	}
+	return minIdx, minHits
+}